@@ -0,0 +1,163 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://idp.example.com/"
+	testClientID = "test-client-id"
+	testKid      = "test-key-1"
+	testNonce    = "expected-nonce"
+)
+
+func newTestClient(pub *rsa.PublicKey) *Client {
+	return &Client{
+		disc: Discovery{Issuer: testIssuer},
+		keys: jwks{Keys: []jwk{rsaJWK(testKid, pub)}},
+	}
+}
+
+func rsaJWK(kid string, pub *rsa.PublicKey) jwk {
+	return jwk{
+		Kty: "RSA",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func baseClaims() IDTokenClaims {
+	now := time.Now()
+	return IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Nonce: testNonce,
+	}
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims IDTokenClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing test token: %v", err)
+	}
+	return signed
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating test key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating second test key: %v", err)
+	}
+
+	client := newTestClient(&key.PublicKey)
+
+	t.Run("valid token", func(t *testing.T) {
+		raw := signRS256(t, key, testKid, baseClaims())
+		claims, err := client.VerifyIDToken(raw, testClientID, testNonce)
+		if err != nil {
+			t.Fatalf("VerifyIDToken() error = %v, want nil", err)
+		}
+		if claims.Nonce != testNonce {
+			t.Errorf("Nonce = %q, want %q", claims.Nonce, testNonce)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		c := baseClaims()
+		c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+		raw := signRS256(t, key, testKid, c)
+		if _, err := client.VerifyIDToken(raw, testClientID, testNonce); err == nil {
+			t.Fatal("VerifyIDToken() error = nil, want expiry error")
+		}
+	})
+
+	t.Run("wrong issuer", func(t *testing.T) {
+		c := baseClaims()
+		c.Issuer = "https://evil.example.com/"
+		raw := signRS256(t, key, testKid, c)
+		if _, err := client.VerifyIDToken(raw, testClientID, testNonce); err == nil {
+			t.Fatal("VerifyIDToken() error = nil, want issuer mismatch error")
+		}
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		c := baseClaims()
+		c.Audience = jwt.ClaimStrings{"someone-else"}
+		raw := signRS256(t, key, testKid, c)
+		if _, err := client.VerifyIDToken(raw, testClientID, testNonce); err == nil {
+			t.Fatal("VerifyIDToken() error = nil, want audience mismatch error")
+		}
+	})
+
+	t.Run("tampered signature", func(t *testing.T) {
+		raw := signRS256(t, key, testKid, baseClaims())
+		parts := strings.Split(raw, ".")
+		sig := []byte(parts[2])
+		sig[0] ^= 0xFF
+		parts[2] = string(sig)
+		tampered := strings.Join(parts, ".")
+		if _, err := client.VerifyIDToken(tampered, testClientID, testNonce); err == nil {
+			t.Fatal("VerifyIDToken() error = nil, want signature error")
+		}
+	})
+
+	t.Run("signed by a different key", func(t *testing.T) {
+		raw := signRS256(t, otherKey, testKid, baseClaims())
+		if _, err := client.VerifyIDToken(raw, testClientID, testNonce); err == nil {
+			t.Fatal("VerifyIDToken() error = nil, want signature error")
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		raw := signRS256(t, key, testKid, baseClaims())
+		if _, err := client.VerifyIDToken(raw, testClientID, "different-nonce"); err == nil {
+			t.Fatal("VerifyIDToken() error = nil, want nonce mismatch error")
+		}
+	})
+
+	t.Run("alg confusion: HMAC signed with the RSA modulus as secret", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, baseClaims())
+		token.Header["kid"] = testKid
+		raw, err := token.SignedString(key.PublicKey.N.Bytes())
+		if err != nil {
+			t.Fatalf("signing HMAC-confusion token: %v", err)
+		}
+		if _, err := client.VerifyIDToken(raw, testClientID, testNonce); err == nil {
+			t.Fatal("VerifyIDToken() error = nil, want unsupported algorithm error")
+		}
+	})
+
+	t.Run("alg=none", func(t *testing.T) {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT","kid":"` + testKid + `"}`))
+		claimsJSON, err := json.Marshal(baseClaims())
+		if err != nil {
+			t.Fatalf("marshalling claims: %v", err)
+		}
+		payload := base64.RawURLEncoding.EncodeToString(claimsJSON)
+		raw := header + "." + payload + "."
+		if _, err := client.VerifyIDToken(raw, testClientID, testNonce); err == nil {
+			t.Fatal("VerifyIDToken() error = nil, want unsupported algorithm error")
+		}
+	})
+}
@@ -2,18 +2,22 @@ package server
 
 import (
 	"bytes"
-	"crypto/tls"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"text/template"
 
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 
 	"github.com/astaxie/beego/session"
+	"github.com/gorilla/mux"
 )
 
 var homeTemplate = `
@@ -23,35 +27,103 @@ var homeTemplate = `
   </head>
   <body>
     <h2>Welcome to the OAuth Authcode Home Page</h2>
-    <p>We don't know who you are.  Please <a href="{{.Domain}}/oauth/authorize?client_id={{.ClientID}}&redirect_uri={{.CallbackURL}}&response_type=code">log in</a>.
+    <p>We don't know who you are.  Please log in with one of:</p>
+    <ul>
+    {{range .Providers}}
+      <li><a href="/login/{{.}}">{{.}}</a></li>
+    {{end}}
+    </ul>
   </body>
 </html>
 `
 
-func homeHandler(config *authConfig) http.HandlerFunc {
+// randomString returns a URL-safe, base64-encoded string built from n
+// cryptographically random bytes, suitable for use as an OAuth state
+// value or a PKCE code verifier.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeChallengeS256 derives the PKCE S256 code_challenge for the given
+// code_verifier, per RFC 7636 section 4.2.
+func codeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func homeHandler(registry *ProviderRegistry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			Providers []string
+		}{registry.Names()}
+
 		t := template.Must(template.New("html").Parse(homeTemplate))
-		t.Execute(w, config)
+		t.Execute(w, data)
 	}
 }
 
-func accessHandler(sessionManager *session.Manager, config *authConfig) http.HandlerFunc {
-
+// loginHandler starts a login attempt against the named provider: it
+// generates the state, PKCE verifier/challenge, and nonce, stashes them
+// in the session, and redirects to that provider's authorization
+// endpoint.
+func loginHandler(sessionManager *session.Manager, registry *ProviderRegistry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["provider"]
+		provider := registry.Get(name)
+		if provider == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		state, err := randomString(32)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		verifier, err := randomString(64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		nonce, err := randomString(32)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		session, _ := sessionManager.SessionStart(w, r)
 		defer session.SessionRelease(w)
 
-		accessToken := session.Get("access_token")
+		session.Set("oauth_provider", name)
+		session.Set("oauth_state", state)
+		session.Set("code_verifier", verifier)
+		session.Set("oidc_nonce", nonce)
 
-		token, err := parseToken(accessToken.(string))
-		if err != nil {
-			fmt.Printf("Error Parsing Token: %v", err)
+		conf := newOAuth2Config(provider)
+		opts := []oauth2.AuthCodeOption{
+			oauth2.SetAuthURLParam("code_challenge", codeChallengeS256(verifier)),
+			oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+			oauth2.SetAuthURLParam("nonce", nonce),
 		}
 
-		if hasScope(token, "test.access", "test.admin") {
-			w.Header().Set("Content-Type", "text/html;charset=utf-8")
-			buf := bytes.NewBufferString(`
+		http.Redirect(w, r, conf.AuthCodeURL(state, opts...), http.StatusFound)
+	}
+}
+
+// accessHandler renders the Access Page. Scope enforcement and token
+// refresh are handled by the RequireValidToken middleware wrapping this
+// handler at the route level.
+func accessHandler() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html;charset=utf-8")
+		buf := bytes.NewBufferString(`
 <html>
   <head>
     <title>Access Page</title>
@@ -63,30 +135,18 @@ func accessHandler(sessionManager *session.Manager, config *authConfig) http.Han
     <p>Visit the <a href="/protected/admin">Admin Page</a>.</p>
   </body>
 </html>`)
-			w.Write(buf.Bytes())
-		} else {
-			fmt.Fprintf(w, "YOU ARE NOT AUTHORIZED")
-		}
+		w.Write(buf.Bytes())
 	}
 }
 
-func adminHandler(sessionManager *session.Manager) http.HandlerFunc {
+// adminHandler renders the Admin Page. Scope enforcement and token
+// refresh are handled by the RequireValidToken middleware wrapping this
+// handler at the route level.
+func adminHandler() http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-
-		session, _ := sessionManager.SessionStart(w, r)
-		defer session.SessionRelease(w)
-
-		accessToken := session.Get("access_token")
-
-		token, err := parseToken(accessToken.(string))
-		if err != nil {
-			fmt.Printf("Error Parsing Token: %v", err)
-		}
-
-		if hasScope(token, "test.admin") {
-			w.Header().Set("Content-Type", "text/html;charset=utf-8")
-			buf := bytes.NewBufferString(`
+		w.Header().Set("Content-Type", "text/html;charset=utf-8")
+		buf := bytes.NewBufferString(`
 <html>
   <head>
     <title>Admin Page</title>
@@ -98,36 +158,52 @@ func adminHandler(sessionManager *session.Manager) http.HandlerFunc {
     <p>Visit the <a href="/protected/access">Access Page</a>.</p>
   </body>
 </html>`)
-			w.Write(buf.Bytes())
-		} else {
-			fmt.Fprintf(w, "YOU ARE NOT AUTHORIZED")
-		}
+		w.Write(buf.Bytes())
+	}
+}
+
+// newOAuth2Config builds the oauth2.Config used to exchange the authcode
+// and, later, to refresh the resulting token. Shared by loginHandler,
+// callbackHandler, and RequireValidToken so all three agree on a given
+// provider's endpoints and scopes. Endpoints come from the provider's
+// OIDC discovery document rather than being hardcoded.
+func newOAuth2Config(provider *Provider) *oauth2.Config {
+	disc := provider.OIDC.Discovery()
+	return &oauth2.Config{
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  provider.CallbackURL,
+		Scopes:       provider.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  disc.AuthorizationEndpoint,
+			TokenURL: disc.TokenEndpoint,
+		},
 	}
 }
 
-func callbackHandler(sessionManager *session.Manager, config *authConfig) http.HandlerFunc {
+func callbackHandler(sessionManager *session.Manager, registry *ProviderRegistry, store TokenStore) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		name := mux.Vars(r)["provider"]
+		provider := registry.Get(name)
+		if provider == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		tlsClient, err := newTLSClient(provider)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
 		ctx := oauth2.NoContext
-		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: tr})
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, tlsClient)
 
 		// Instantiating the OAuth2 package to exchange the Code for a Token
-		conf := &oauth2.Config{
-			ClientID:     config.ClientID,
-			ClientSecret: config.ClientSecret,
-			RedirectURL:  config.CallbackURL,
-			Scopes:       []string{"openid", "test.access", "test.admin"},
-			Endpoint: oauth2.Endpoint{
-				AuthURL:  config.Domain + "/oauth/authorize",
-				TokenURL: config.Domain + "/oauth/token",
-			},
-		}
-
-		// Getting the Code that we got from Auth0
+		conf := newOAuth2Config(provider)
+
+		// Getting the Code that we got from the IdP
 		e := r.URL.Query().Get("error")
 		if len(e) > 0 {
 			authError := errors.New(e)
@@ -142,8 +218,29 @@ func callbackHandler(sessionManager *session.Manager, config *authConfig) http.H
 			return
 		}
 
+		session, _ := sessionManager.SessionStart(w, r)
+		defer session.SessionRelease(w)
+
+		// The callback must land back on the same provider the login
+		// attempt started with.
+		if wantProvider, _ := session.Get("oauth_provider").(string); wantProvider != name {
+			http.Error(w, "provider mismatch", http.StatusBadRequest)
+			return
+		}
+
+		// Validating the state parameter against the value we stashed in the
+		// session at login time, to guard against CSRF (RFC 6749 §10.12).
+		wantState, _ := session.Get("oauth_state").(string)
+		gotState := r.URL.Query().Get("state")
+		if wantState == "" || subtle.ConstantTimeCompare([]byte(wantState), []byte(gotState)) != 1 {
+			http.Error(w, "state mismatch", http.StatusBadRequest)
+			return
+		}
+
+		verifier, _ := session.Get("code_verifier").(string)
+
 		// Exchanging the code for a token
-		token, err := conf.Exchange(ctx, code)
+		token, err := conf.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -151,7 +248,7 @@ func callbackHandler(sessionManager *session.Manager, config *authConfig) http.H
 
 		// Getting now the User information
 		client := conf.Client(ctx, token)
-		resp, err := client.Get(config.Domain + "/userinfo")
+		resp, err := client.Get(provider.OIDC.Discovery().UserinfoEndpoint)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -172,19 +269,110 @@ func callbackHandler(sessionManager *session.Manager, config *authConfig) http.H
 			return
 		}
 
-		// Saving the information to the session.
-		// We're using https://github.com/astaxie/beego/tree/master/session
-		// The GlobalSessions variable is initialized in another file
-		// Check https://github.com/auth0/auth0-golang/blob/master/examples/regular-web-app/app/app.go
-		session, _ := sessionManager.SessionStart(w, r)
-		defer session.SessionRelease(w)
+		// Verifying the ID token's signature, issuer, audience, expiry,
+		// and nonce before trusting anything it claims.
+		idToken, _ := token.Extra("id_token").(string)
+		nonce, _ := session.Get("oidc_nonce").(string)
+		if _, err := provider.OIDC.VerifyIDToken(idToken, provider.ClientID, nonce); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		// Saving the tokens and profile to the TokenStore, keyed by the
+		// Beego session id, rather than stashing them directly in the
+		// (in-memory, single-instance) Beego session.
+		rec := &TokenRecord{
+			Provider:     name,
+			AccessToken:  token.AccessToken,
+			RefreshToken: token.RefreshToken,
+			IDToken:      idToken,
+			Expiry:       token.Expiry,
+			Scopes:       conf.Scopes,
+			Profile:      profile,
+		}
+		if err := store.Set(session.SessionID(), rec); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-		session.Set("id_token", token.Extra("id_token"))
-		session.Set("access_token", token.AccessToken)
-		session.Set("profile", profile)
+		session.Delete("oauth_provider")
+		session.Delete("oauth_state")
+		session.Delete("code_verifier")
+		session.Delete("oidc_nonce")
 
 		// Redirect to logged in page
 		http.Redirect(w, r, "/protected/access", http.StatusMovedPermanently)
 
 	}
 }
+
+// logoutHandler implements RP-Initiated Logout: it destroys the local
+// session and TokenStore record, then redirects the user agent to the
+// IdP's end_session_endpoint so it can clear its own session too.
+func logoutHandler(sessionManager *session.Manager, registry *ProviderRegistry, store TokenStore) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := sessionManager.SessionStart(w, r)
+		sid := session.SessionID()
+		rec, _ := store.Get(sid)
+		session.SessionRelease(w)
+
+		store.Delete(sid)
+
+		// Destroy the local session: expire its cookie immediately and
+		// drop the backing session record.
+		sessionManager.SessionDestroy(w, r)
+
+		if rec == nil {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		provider := registry.Get(rec.Provider)
+		if provider == nil {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		// Start a fresh session purely to round-trip the logout state
+		// through the IdP's end-session redirect.
+		newSession, _ := sessionManager.SessionStart(w, r)
+		defer newSession.SessionRelease(w)
+
+		state, err := randomString(32)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		newSession.Set("logout_state", state)
+
+		values := url.Values{}
+		values.Set("post_logout_redirect_uri", provider.LogoutRedirectURL)
+		values.Set("state", state)
+		if rec.IDToken != "" {
+			values.Set("id_token_hint", rec.IDToken)
+		}
+
+		http.Redirect(w, r, provider.OIDC.Discovery().EndSessionEndpoint+"?"+values.Encode(), http.StatusFound)
+	}
+}
+
+// logoutCallbackHandler validates the state round-tripped through the
+// IdP's end_session_endpoint and lands the user back on the home page.
+func logoutCallbackHandler(sessionManager *session.Manager) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := sessionManager.SessionStart(w, r)
+		defer session.SessionRelease(w)
+
+		wantState, _ := session.Get("logout_state").(string)
+		gotState := r.URL.Query().Get("state")
+		if wantState == "" || subtle.ConstantTimeCompare([]byte(wantState), []byte(gotState)) != 1 {
+			http.Error(w, "state mismatch", http.StatusBadRequest)
+			return
+		}
+		session.Delete("logout_state")
+
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+
+	"github.com/astaxie/beego/session"
+)
+
+// RequireValidToken returns middleware that loads the caller's token
+// record from store, resolves which provider it came from, transparently
+// refreshes it via that provider's oauth2.TokenSource when the access
+// token has expired, persists the (possibly rotated) token back to the
+// store, and rejects the request unless the resulting JWT carries at
+// least one of scopes. Both protected handlers (accessHandler,
+// adminHandler) compose this instead of duplicating the
+// lookup/refresh/scope-check logic themselves.
+func RequireValidToken(sessionManager *session.Manager, registry *ProviderRegistry, store TokenStore, scopes ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+
+			session, _ := sessionManager.SessionStart(w, r)
+			defer session.SessionRelease(w)
+
+			sid := session.SessionID()
+			rec, err := store.Get(sid)
+			if err != nil {
+				http.Error(w, "not authenticated", http.StatusUnauthorized)
+				return
+			}
+
+			provider := registry.Get(rec.Provider)
+			if provider == nil {
+				http.Error(w, "unknown provider", http.StatusUnauthorized)
+				return
+			}
+
+			tlsClient, err := newTLSClient(provider)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			ctx := oauth2.NoContext
+			ctx = context.WithValue(ctx, oauth2.HTTPClient, tlsClient)
+
+			conf := newOAuth2Config(provider)
+			ts := conf.TokenSource(ctx, &oauth2.Token{
+				AccessToken:  rec.AccessToken,
+				RefreshToken: rec.RefreshToken,
+				Expiry:       rec.Expiry,
+			})
+
+			fresh, err := ts.Token()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			if fresh.AccessToken != rec.AccessToken {
+				rec.AccessToken = fresh.AccessToken
+				rec.RefreshToken = fresh.RefreshToken
+				rec.Expiry = fresh.Expiry
+				if err := store.Refresh(sid, rec); err != nil {
+					fmt.Printf("Error Persisting Refreshed Token: %v", err)
+				}
+			}
+
+			token, err := parseToken(fresh.AccessToken)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			if !hasScope(token, scopes...) {
+				fmt.Fprintf(w, "YOU ARE NOT AUTHORIZED")
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a TokenStore when no record exists for the
+// given session id.
+var ErrNotFound = errors.New("token store: record not found")
+
+// TokenRecord holds everything we persist about a logged-in user's OAuth
+// session: the tokens returned by the IdP plus the profile fetched from
+// the userinfo endpoint.
+type TokenRecord struct {
+	Provider     string
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	Expiry       time.Time
+	Scopes       []string
+	Profile      map[string]interface{}
+}
+
+// TokenStore persists TokenRecords keyed by Beego session id. This lets
+// token lifetime outlive a single Beego in-memory session and lets
+// multiple instances of this app share the same logged-in sessions.
+type TokenStore interface {
+	Get(sid string) (*TokenRecord, error)
+	Set(sid string, rec *TokenRecord) error
+	Delete(sid string) error
+	Refresh(sid string, rec *TokenRecord) error
+}
+
+// memoryTokenStore is a process-local TokenStore. It's the default used
+// when no external store is configured; it does not survive a restart
+// and does not scale across multiple instances.
+type memoryTokenStore struct {
+	mu      sync.RWMutex
+	records map[string]*TokenRecord
+}
+
+// NewMemoryTokenStore returns a TokenStore that keeps records in an
+// in-process map. Suitable for local development and tests.
+func NewMemoryTokenStore() TokenStore {
+	return &memoryTokenStore{records: make(map[string]*TokenRecord)}
+}
+
+func (s *memoryTokenStore) Get(sid string) (*TokenRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[sid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *rec
+	return &cp, nil
+}
+
+func (s *memoryTokenStore) Set(sid string, rec *TokenRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *rec
+	s.records[sid] = &cp
+	return nil
+}
+
+func (s *memoryTokenStore) Delete(sid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, sid)
+	return nil
+}
+
+func (s *memoryTokenStore) Refresh(sid string, rec *TokenRecord) error {
+	return s.Set(sid, rec)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresTokenStore persists TokenRecords in a Postgres table, so
+// sessions survive restarts and are shared across horizontally scaled
+// instances without requiring a Redis deployment.
+//
+// Expected schema:
+//
+//	CREATE TABLE oauth_tokens (
+//		session_id    TEXT PRIMARY KEY,
+//		provider      TEXT NOT NULL,
+//		access_token  TEXT NOT NULL,
+//		refresh_token TEXT NOT NULL,
+//		id_token      TEXT NOT NULL,
+//		expiry        TIMESTAMPTZ NOT NULL,
+//		scopes        TEXT NOT NULL,
+//		profile       JSONB NOT NULL
+//	);
+type postgresTokenStore struct {
+	db *sql.DB
+}
+
+// NewPostgresTokenStore returns a TokenStore backed by the given
+// database handle. The caller owns the *sql.DB's lifecycle.
+func NewPostgresTokenStore(db *sql.DB) TokenStore {
+	return &postgresTokenStore{db: db}
+}
+
+func (s *postgresTokenStore) Get(sid string) (*TokenRecord, error) {
+	var (
+		rec          TokenRecord
+		scopes       string
+		profileBytes []byte
+	)
+
+	row := s.db.QueryRow(`SELECT provider, access_token, refresh_token, id_token, expiry, scopes, profile
+		FROM oauth_tokens WHERE session_id = $1`, sid)
+	if err := row.Scan(&rec.Provider, &rec.AccessToken, &rec.RefreshToken, &rec.IDToken, &rec.Expiry, &scopes, &profileBytes); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if scopes != "" {
+		rec.Scopes = strings.Split(scopes, " ")
+	}
+	if len(profileBytes) > 0 {
+		if err := json.Unmarshal(profileBytes, &rec.Profile); err != nil {
+			return nil, err
+		}
+	}
+	return &rec, nil
+}
+
+func (s *postgresTokenStore) Set(sid string, rec *TokenRecord) error {
+	profileBytes, err := json.Marshal(rec.Profile)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO oauth_tokens (session_id, provider, access_token, refresh_token, id_token, expiry, scopes, profile)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (session_id) DO UPDATE SET
+			provider = EXCLUDED.provider,
+			access_token = EXCLUDED.access_token,
+			refresh_token = EXCLUDED.refresh_token,
+			id_token = EXCLUDED.id_token,
+			expiry = EXCLUDED.expiry,
+			scopes = EXCLUDED.scopes,
+			profile = EXCLUDED.profile`,
+		sid, rec.Provider, rec.AccessToken, rec.RefreshToken, rec.IDToken, rec.Expiry, strings.Join(rec.Scopes, " "), profileBytes)
+	return err
+}
+
+func (s *postgresTokenStore) Delete(sid string) error {
+	_, err := s.db.Exec(`DELETE FROM oauth_tokens WHERE session_id = $1`, sid)
+	return err
+}
+
+func (s *postgresTokenStore) Refresh(sid string, rec *TokenRecord) error {
+	return s.Set(sid, rec)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// redisTokenStore persists TokenRecords in Redis as JSON blobs, so
+// sessions survive restarts and are shared across horizontally scaled
+// instances of this app.
+type redisTokenStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisTokenStore returns a TokenStore backed by the given Redis
+// client. Records are written with the supplied ttl so abandoned
+// sessions expire on their own; pass 0 to keep records until they're
+// explicitly deleted.
+func NewRedisTokenStore(client *redis.Client, ttl time.Duration) TokenStore {
+	return &redisTokenStore{client: client, ttl: ttl}
+}
+
+func (s *redisTokenStore) key(sid string) string {
+	return "oauth-authcode:token:" + sid
+}
+
+func (s *redisTokenStore) Get(sid string) (*TokenRecord, error) {
+	raw, err := s.client.Get(s.key(sid)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec TokenRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *redisTokenStore) Set(sid string, rec *TokenRecord) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(s.key(sid), raw, s.ttl).Err()
+}
+
+func (s *redisTokenStore) Delete(sid string) error {
+	return s.client.Del(s.key(sid)).Err()
+}
+
+func (s *redisTokenStore) Refresh(sid string, rec *TokenRecord) error {
+	return s.Set(sid, rec)
+}